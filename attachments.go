@@ -0,0 +1,202 @@
+package soap
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/textproto"
+	"reflect"
+	"strings"
+)
+
+const namespaceXOP = "http://www.w3.org/2004/08/xop/include"
+
+// BinaryAttachment wraps binary data that Client.Call sends as an
+// MTOM/XOP attachment instead of inlining it as base64. Embed it in a
+// request field and it marshals as an <xop:Include href="cid:..."/>; the
+// actual bytes travel as a separate MIME part. On the response side, a
+// BinaryAttachment field is decoded the same way and, once Call has
+// matched its href against the multipart response (see WithAttachments),
+// Data is filled in automatically.
+type BinaryAttachment struct {
+	// ContentID identifies the MIME part carrying Data. If empty when the
+	// request is sent, Call assigns one.
+	ContentID string
+	// ContentType defaults to application/octet-stream if empty.
+	ContentType string
+	Data        []byte
+}
+
+// MarshalXML implements xml.Marshaler, emitting the wrapping element
+// given by start with a single <xop:Include> child referencing ContentID.
+func (a *BinaryAttachment) MarshalXML(e *xml.Encoder, start xml.StartElement) error {
+	if err := e.EncodeToken(start); err != nil {
+		return err
+	}
+	include := xml.StartElement{
+		Name: xml.Name{Local: "xop:Include"},
+		Attr: []xml.Attr{
+			{Name: xml.Name{Local: "xmlns:xop"}, Value: namespaceXOP},
+			{Name: xml.Name{Local: "href"}, Value: "cid:" + a.ContentID},
+		},
+	}
+	if err := e.EncodeToken(include); err != nil {
+		return err
+	}
+	if err := e.EncodeToken(include.End()); err != nil {
+		return err
+	}
+	return e.EncodeToken(start.End())
+}
+
+// UnmarshalXML implements xml.Unmarshaler, reading the ContentID out of a
+// nested <xop:Include href="cid:..."/>. Data is left for Call to resolve
+// against the attachments it collected from the multipart response.
+func (a *BinaryAttachment) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
+	for {
+		tok, err := d.Token()
+		if err != nil {
+			return err
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			if t.Name.Local == "Include" {
+				for _, attr := range t.Attr {
+					if attr.Name.Local == "href" {
+						a.ContentID = strings.TrimPrefix(attr.Value, "cid:")
+					}
+				}
+			}
+			if err := d.Skip(); err != nil {
+				return err
+			}
+		case xml.EndElement:
+			if t.Name.Local == start.Name.Local {
+				return nil
+			}
+		}
+	}
+}
+
+// findBinaryAttachments walks v looking for *BinaryAttachment values,
+// however deeply they are nested in structs/slices/pointers.
+func findBinaryAttachments(v interface{}) []*BinaryAttachment {
+	var out []*BinaryAttachment
+	visited := make(map[interface{}]bool)
+
+	var walk func(rv reflect.Value)
+	walk = func(rv reflect.Value) {
+		if !rv.IsValid() {
+			return
+		}
+		switch rv.Kind() {
+		case reflect.Ptr:
+			if rv.IsNil() {
+				return
+			}
+			if ba, ok := rv.Interface().(*BinaryAttachment); ok {
+				out = append(out, ba)
+				return
+			}
+			if visited[rv.Interface()] {
+				return
+			}
+			visited[rv.Interface()] = true
+			walk(rv.Elem())
+		case reflect.Interface:
+			walk(rv.Elem())
+		case reflect.Struct:
+			for i := 0; i < rv.NumField(); i++ {
+				if rv.Type().Field(i).PkgPath != "" { // unexported
+					continue
+				}
+				walk(rv.Field(i))
+			}
+		case reflect.Slice, reflect.Array:
+			for i := 0; i < rv.Len(); i++ {
+				walk(rv.Index(i))
+			}
+		}
+	}
+	walk(reflect.ValueOf(v))
+	return out
+}
+
+// buildMTOMRequestBody wraps xmlBytes and attachments into a
+// multipart/related MTOM/XOP body, returning the body and the Content-Type
+// header to send it with.
+func buildMTOMRequestBody(xmlBytes []byte, soapContentType string, attachments []*BinaryAttachment) (io.Reader, string, error) {
+	var buf bytes.Buffer
+	mw := multipart.NewWriter(&buf)
+
+	rootHeader := textproto.MIMEHeader{}
+	rootHeader.Set("Content-Type", fmt.Sprintf(`application/xop+xml; charset=UTF-8; type=%q`, soapContentType))
+	rootHeader.Set("Content-Transfer-Encoding", "8bit")
+	rootHeader.Set("Content-ID", "<root.message>")
+	rp, err := mw.CreatePart(rootHeader)
+	if err != nil {
+		return nil, "", err
+	}
+	if _, err := rp.Write(xmlBytes); err != nil {
+		return nil, "", err
+	}
+
+	for _, a := range attachments {
+		contentType := a.ContentType
+		if contentType == "" {
+			contentType = "application/octet-stream"
+		}
+		ph := textproto.MIMEHeader{}
+		ph.Set("Content-Type", contentType)
+		ph.Set("Content-Transfer-Encoding", "binary")
+		ph.Set("Content-ID", "<"+a.ContentID+">")
+		p, err := mw.CreatePart(ph)
+		if err != nil {
+			return nil, "", err
+		}
+		if _, err := p.Write(a.Data); err != nil {
+			return nil, "", err
+		}
+	}
+	if err := mw.Close(); err != nil {
+		return nil, "", err
+	}
+
+	contentType := fmt.Sprintf(`multipart/related; type="application/xop+xml"; boundary=%q; start="<root.message>"`, mw.Boundary())
+	return &buf, contentType, nil
+}
+
+// AttachmentSet collects the MTOM/XOP attachments found in a multipart
+// response, keyed by Content-ID (without the surrounding angle brackets).
+type AttachmentSet struct {
+	attachments map[string][]byte
+}
+
+// NewAttachmentSet constructs an empty AttachmentSet.
+func NewAttachmentSet() *AttachmentSet {
+	return &AttachmentSet{attachments: make(map[string][]byte)}
+}
+
+func (s *AttachmentSet) set(contentID string, data []byte) {
+	s.attachments[contentID] = data
+}
+
+// Get returns the attachment stored under contentID, if any.
+func (s *AttachmentSet) Get(contentID string) ([]byte, bool) {
+	data, ok := s.attachments[contentID]
+	return data, ok
+}
+
+type attachmentSetKeyType struct{}
+
+var attachmentSetKey = attachmentSetKeyType{}
+
+// WithAttachments returns a context that makes Call collect the
+// attachments of a multipart MTOM/XOP response into set, and resolve any
+// BinaryAttachment fields of the response struct against it.
+func WithAttachments(ctx context.Context, set *AttachmentSet) context.Context {
+	return context.WithValue(ctx, attachmentSetKey, set)
+}
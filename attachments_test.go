@@ -0,0 +1,110 @@
+package soap
+
+import (
+	"encoding/xml"
+	"io"
+	"mime"
+	"mime/multipart"
+	"strings"
+	"testing"
+)
+
+type attachTestRequest struct {
+	XMLName struct{}          `xml:"Req"`
+	File    *BinaryAttachment `xml:"File"`
+	Nested  struct {
+		Other *BinaryAttachment `xml:"Other"`
+	}
+}
+
+func TestBinaryAttachmentMarshalUnmarshalRoundTrip(t *testing.T) {
+	a := &BinaryAttachment{ContentID: "att1@soap"}
+
+	out, err := xml.Marshal(a)
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+	if !strings.Contains(string(out), `href="cid:att1@soap"`) {
+		t.Fatalf("expected xop:Include href, got: %s", out)
+	}
+
+	var decoded BinaryAttachment
+	if err := xml.Unmarshal(out, &decoded); err != nil {
+		t.Fatalf("Unmarshal: %v", err)
+	}
+	if decoded.ContentID != "att1@soap" {
+		t.Fatalf("unexpected ContentID after round trip: %q", decoded.ContentID)
+	}
+}
+
+func TestFindBinaryAttachmentsWalksNestedStructs(t *testing.T) {
+	req := &attachTestRequest{
+		File: &BinaryAttachment{ContentID: "a"},
+	}
+	req.Nested.Other = &BinaryAttachment{ContentID: "b"}
+
+	found := findBinaryAttachments(req)
+	if len(found) != 2 {
+		t.Fatalf("expected 2 attachments, got %d", len(found))
+	}
+	ids := map[string]bool{found[0].ContentID: true, found[1].ContentID: true}
+	if !ids["a"] || !ids["b"] {
+		t.Fatalf("unexpected attachment IDs: %+v", ids)
+	}
+}
+
+func TestBuildMTOMRequestBodyProducesMultipartWithAttachment(t *testing.T) {
+	xmlBytes := []byte(`<Envelope/>`)
+	attachments := []*BinaryAttachment{{ContentID: "att1@soap", ContentType: "application/octet-stream", Data: []byte("binary-payload")}}
+
+	body, contentType, err := buildMTOMRequestBody(xmlBytes, SoapContentType11, attachments)
+	if err != nil {
+		t.Fatalf("buildMTOMRequestBody: %v", err)
+	}
+
+	mediaType, params, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		t.Fatalf("ParseMediaType: %v", err)
+	}
+	if mediaType != "multipart/related" {
+		t.Fatalf("expected multipart/related, got %q", mediaType)
+	}
+
+	mr := multipart.NewReader(body, params["boundary"])
+	var parts [][]byte
+	for {
+		p, err := mr.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("NextPart: %v", err)
+		}
+		data, err := io.ReadAll(p)
+		if err != nil {
+			t.Fatalf("ReadAll: %v", err)
+		}
+		parts = append(parts, data)
+	}
+	if len(parts) != 2 {
+		t.Fatalf("expected 2 parts (root + attachment), got %d", len(parts))
+	}
+	if string(parts[0]) != "<Envelope/>" {
+		t.Fatalf("unexpected root part: %s", parts[0])
+	}
+	if string(parts[1]) != "binary-payload" {
+		t.Fatalf("unexpected attachment part: %s", parts[1])
+	}
+}
+
+func TestAttachmentSetGetSet(t *testing.T) {
+	s := NewAttachmentSet()
+	if _, ok := s.Get("missing"); ok {
+		t.Fatal("expected Get on empty set to report not found")
+	}
+	s.set("cid1", []byte("data"))
+	data, ok := s.Get("cid1")
+	if !ok || string(data) != "data" {
+		t.Fatalf("unexpected Get result: %q %v", data, ok)
+	}
+}
@@ -1,17 +1,19 @@
 package soap
 
 import (
+	"bufio"
 	"bytes"
 	"context"
 	"encoding/xml"
 	"errors"
 	"fmt"
 	"io"
-	"io/ioutil"
 	"mime"
 	"mime/multipart"
 	"net/http"
+	"reflect"
 	"strings"
+	"time"
 )
 
 // UserAgent is the default user agent
@@ -51,6 +53,45 @@ type Client struct {
 	RequestHeaderFn func(http.Header) // optional, allows to modify the request header before it gets submitted.
 	SoapVersion     string
 	HTTPClientDoFn  func(req *http.Request) (*http.Response, error)
+
+	// Security, if set, injects a <wsse:Security> header into outgoing
+	// envelopes and, if it sets VerifyTimestamp, validates a response's
+	// <wsu:Timestamp>.
+	Security *Security
+
+	// faultDetailTypes maps a SOAPAction to the concrete type its fault
+	// <detail>/<Detail> element should be unmarshalled into. Populate it
+	// via RegisterFaultDetail.
+	faultDetailTypes map[string]reflect.Type
+
+	// interceptors wrap every Call, outermost first. Register additional
+	// ones with Use; see middleware.go for the built-in ones. They run
+	// around a default, innermost set built from RequestHeaderFn,
+	// HTTPClientDoFn and Log on every Call - see defaultInterceptors.
+	interceptors []Interceptor
+}
+
+// requestContext threads per-call state between the interceptor chain and
+// doCall's actual HTTP exchange. RequestHeaderFn and HTTPClientDoFn act on
+// the raw *http.Request/*http.Response, which an Invoker never exposes,
+// and LoggingInterceptor needs the fully marshalled envelope - including
+// anything Client.Security added - rather than the typed request/response
+// values it's otherwise called with. doCall populates requestXML once it
+// has marshalled the envelope; any interceptor wrapping it can read it
+// back after next returns.
+type requestContext struct {
+	headerFn   func(http.Header)
+	httpDoFn   func(*http.Request) (*http.Response, error)
+	requestXML []byte
+}
+
+type requestContextKeyType struct{}
+
+var requestContextKey = requestContextKeyType{}
+
+func requestContextFrom(ctx context.Context) *requestContext {
+	rc, _ := ctx.Value(requestContextKey).(*requestContext)
+	return rc
 }
 
 // NewClient constructor. SOAP 1.1 is used by default. Switch to SOAP 1.2 with
@@ -78,22 +119,80 @@ func (c *Client) UseSoap12() {
 	c.ContentType = SoapContentType12
 }
 
-// Call makes a SOAP call
+// Call makes a SOAP call, running it through any interceptors registered
+// via Use (outermost first), then through defaultInterceptors (innermost,
+// closest to doCall) around the actual request/response exchange.
 func (c *Client) Call(ctx context.Context, soapAction string, request, response interface{}) (*http.Response, error) {
+	ctx = context.WithValue(ctx, requestContextKey, &requestContext{})
+
+	inv := func(ctx context.Context, request, response interface{}) (*http.Response, error) {
+		return c.doCall(ctx, soapAction, request, response)
+	}
+	chain := append(append([]Interceptor(nil), c.interceptors...), c.defaultInterceptors()...)
+	for i := len(chain) - 1; i >= 0; i-- {
+		interceptor, next := chain[i], inv
+		inv = func(ctx context.Context, request, response interface{}) (*http.Response, error) {
+			return interceptor(ctx, soapAction, request, response, next)
+		}
+	}
+	return inv(ctx, request, response)
+}
+
+// defaultInterceptors rebuilds, on every Call, the interceptors backing
+// RequestHeaderFn, HTTPClientDoFn and Log - reading the fields fresh each
+// time so a caller that mutates them between calls is honoured. They are
+// always appended last, i.e. innermost, so a chain-wrapping interceptor
+// added via Use (a retry, say) re-applies them on every underlying
+// attempt instead of once for the whole call.
+func (c *Client) defaultInterceptors() []Interceptor {
+	interceptors := []Interceptor{requestHeaderInterceptor(c.RequestHeaderFn), httpDoInterceptor(c.HTTPClientDoFn)}
+	if c.Log != nil {
+		interceptors = append(interceptors, LoggingInterceptor(c.Log))
+	}
+	return interceptors
+}
+
+// doCall performs a single request/response exchange for soapAction,
+// without running any interceptors. It is the innermost Invoker of
+// Call's interceptor chain.
+func (c *Client) doCall(ctx context.Context, soapAction string, request, response interface{}) (*http.Response, error) {
 	envelope := Envelope{
-		Body: Body{Content: request},
+		Xmlns: namespaceSoap11,
+		Body:  Body{Content: request},
+	}
+	if c.SoapVersion == SoapVersion12 {
+		envelope.Xmlns = namespaceSoap12
+	}
+	if c.Security != nil {
+		sec, err := c.Security.securityHeader()
+		if err != nil {
+			return nil, err
+		}
+		envelope.Header = &Header{Content: sec}
+	}
+
+	reqAttachments := findBinaryAttachments(request)
+	for i, a := range reqAttachments {
+		if a.ContentID == "" {
+			a.ContentID = fmt.Sprintf("attachment%d@soap", i+1)
+		}
 	}
 
 	xmlBytes, err := c.Marshaller.Marshal(envelope)
 	if err != nil {
 		return nil, err
 	}
-	// Adjust namespaces for SOAP 1.2
-	if c.SoapVersion == SoapVersion12 {
-		xmlBytes = replaceSoap11to12(xmlBytes)
+
+	var body io.Reader = bytes.NewReader(xmlBytes)
+	contentType := c.ContentType
+	if len(reqAttachments) > 0 {
+		body, contentType, err = buildMTOMRequestBody(xmlBytes, c.ContentType, reqAttachments)
+		if err != nil {
+			return nil, err
+		}
 	}
 
-	req, err := http.NewRequestWithContext(ctx, "POST", c.url, bytes.NewReader(xmlBytes))
+	req, err := http.NewRequestWithContext(ctx, "POST", c.url, body)
 	if err != nil {
 		return nil, err
 	}
@@ -101,7 +200,7 @@ func (c *Client) Call(ctx context.Context, soapAction string, request, response
 		req.SetBasicAuth(c.auth.Login, c.auth.Password)
 	}
 
-	req.Header.Add("Content-Type", c.ContentType)
+	req.Header.Add("Content-Type", contentType)
 	ua := c.UserAgent
 	if ua == "" {
 		ua = userAgent
@@ -113,28 +212,53 @@ func (c *Client) Call(ctx context.Context, soapAction string, request, response
 	}
 
 	req.Close = true
-	if c.RequestHeaderFn != nil {
-		c.RequestHeaderFn(req.Header)
+
+	// headerFn/doFn default to the plain Client fields, but a
+	// requestHeaderInterceptor/httpDoInterceptor in the chain (see
+	// defaultInterceptors) may have set a fresher value on rc; go through
+	// rc so retries and other chain-wrapping interceptors observe the same
+	// RequestHeaderFn/HTTPClientDoFn on every attempt that Call saw.
+	headerFn := c.RequestHeaderFn
+	doFn := c.HTTPClientDoFn
+	rc := requestContextFrom(ctx)
+	if rc != nil {
+		rc.requestXML = xmlBytes
+		if rc.headerFn != nil {
+			headerFn = rc.headerFn
+		}
+		if rc.httpDoFn != nil {
+			doFn = rc.httpDoFn
+		}
 	}
-	c.Log("POST to", c.url, "with\n", xmlBytes)
-	c.Log("Header", req.Header)
-	httpResponse, err := c.HTTPClientDoFn(req)
+	if headerFn != nil {
+		headerFn(req.Header)
+	}
+	httpResponse, err := doFn(req)
 	if err != nil {
 		return nil, err
 	}
 	defer httpResponse.Body.Close()
 
-	c.Log("\n\n## Response header:\n", httpResponse.Header)
+	// Response struct may be nil, e.g. if only a Status 200 is expected. In
+	// this case, a dummyContent placeholder stands in for it; a SOAP Fault
+	// is decoded into Body.Fault either way.
+	respEnvelope := &Envelope{Body: Body{Content: response}}
+	if response == nil {
+		respEnvelope.Body = Body{Content: &dummyContent{}} // must be a pointer in dummyContent
+	}
 
 	mediaType, params, err := mime.ParseMediaType(httpResponse.Header.Get("Content-Type"))
 	if err != nil {
 		c.Log("WARNING:", err)
 	}
 	c.Log("MIMETYPE:", mediaType)
-	var rawBody []byte
-	if strings.HasPrefix(mediaType, "multipart/") { // MULTIPART MESSAGE
+
+	// Both of the branches below decode directly off httpResponse.Body (or
+	// the relevant multipart.Part) via Body.UnmarshalXML, so a large
+	// response is never buffered into memory as a whole.
+	attachSet, _ := ctx.Value(attachmentSetKey).(*AttachmentSet)
+	if strings.HasPrefix(mediaType, "multipart/") { // MULTIPART MESSAGE, possibly carrying MTOM/XOP attachments
 		mr := multipart.NewReader(httpResponse.Body, params["boundary"])
-		// If this is a multipart message, search for the soapy part
 		foundSoap := false
 		for {
 			p, err := mr.NextPart()
@@ -144,144 +268,85 @@ func (c *Client) Call(ctx context.Context, soapAction string, request, response
 			if err != nil {
 				return nil, err
 			}
-			slurp, err := ioutil.ReadAll(p)
-			if err != nil {
+			br := bufio.NewReader(p)
+			prefix, err := br.Peek(len(soapPrefixTagLC))
+			if err != nil && err != io.EOF {
 				return nil, err
 			}
-			if bytes.HasPrefix(slurp, soapPrefixTagLC) || bytes.HasPrefix(slurp, soapPrefixTagUC) {
-				rawBody = slurp
-				foundSoap = true
-				break
+			if !bytes.HasPrefix(prefix, soapPrefixTagLC) && !bytes.HasPrefix(prefix, soapPrefixTagUC) {
+				// Not the SOAP root part: an MTOM/XOP attachment.
+				cid := strings.Trim(p.Header.Get("Content-Id"), "<>")
+				if attachSet != nil && cid != "" {
+					data, err := io.ReadAll(br)
+					if err != nil {
+						return nil, err
+					}
+					attachSet.set(cid, data)
+				} else {
+					io.Copy(io.Discard, br) // drain so mr.NextPart can advance
+				}
+				continue
+			}
+			if err := xml.NewDecoder(br).Decode(respEnvelope); err != nil {
+				return httpResponse, fmt.Errorf("soap/client.go Call(): could not decode response: %s", err)
 			}
+			foundSoap = true
 		}
 		if !foundSoap {
 			return nil, errors.New("multipart message does contain a soapy part")
 		}
 	} else { // SINGLE PART MESSAGE
-		rawBody, err = ioutil.ReadAll(httpResponse.Body)
-		if err != nil {
-			return httpResponse, err // return both
-		}
-		// Check if there is a body and if yes if it's a soapy one.
-		if len(rawBody) == 0 {
-			c.Log("INFO: Response Body is empty!")
-			return httpResponse, nil // Empty responses are ok. Sometimes Sometimes only a Status 200 or 202 comes back
-		}
-		// There is a message body, but it's not SOAP. We cannot handle this!
-		if !(bytes.Contains(rawBody, soapPrefixTagLC) || bytes.Contains(rawBody, soapPrefixTagUC)) {
-			c.Log("This is not a SOAP-Message: \n", rawBody)
-			return nil, errors.New("This is not a SOAP-Message: \n" + string(rawBody))
+		if err := xml.NewDecoder(httpResponse.Body).Decode(respEnvelope); err != nil {
+			if err == io.EOF {
+				c.Log("INFO: Response Body is empty!")
+				return httpResponse, nil // Empty responses are ok. Sometimes only a Status 200 or 202 comes back
+			}
+			return httpResponse, fmt.Errorf("soap/client.go Call(): could not decode response: %s", err)
 		}
-		c.Log("RAWBODY\n", rawBody)
 	}
 
-	// We have an empty body or a SOAP body
-	c.Log("\n\n## Response body:\n", rawBody)
-
-	// Our structs for Envelope, Header, Body and Fault are tagged with namespace
-	// for SOAP 1.1. Therefore we must adjust namespaces for incoming SOAP 1.2
-	// messages
-	rawBody = replaceSoap12to11(rawBody)
-
-	respEnvelope := &Envelope{
-		Body: Body{Content: response},
-	}
-	// Response struct may be nil, e.g. if only a Status 200 is expected. In this
-	// case, we need a Dummy response to avoid a nil pointer if we receive a
-	// SOAP-Fault instead of the empty message (unmarshalling would fail).
-	if response == nil {
-		respEnvelope.Body = Body{Content: &dummyContent{}} // must be a pointer in dummyContent
-	}
-	if err := xml.Unmarshal(rawBody, respEnvelope); err != nil {
-		return nil, fmt.Errorf("soap/client.go Call(): COULD NOT UNMARSHAL: %s\n", err)
+	if c.Security != nil && c.Security.VerifyTimestamp != nil {
+		if err := c.verifyResponseTimestamp(respEnvelope); err != nil {
+			return nil, err
+		}
 	}
 
-	// If a SOAP Fault is received, try to jsonMarshal it and return it via the
-	// error.
+	// If a SOAP Fault is received, decode it into a typed *SoapFault
+	// (using any detail type registered for this operation) instead of
+	// collapsing it into a formatted string.
 	if fault := respEnvelope.Body.Fault; fault != nil {
-		return nil, errors.New("SOAP FAULT:\n" + formatFaultXML(rawBody, 1))
+		return nil, c.newSoapFault(soapAction, fault)
+	}
+
+	if attachSet != nil {
+		for _, a := range findBinaryAttachments(response) {
+			if data, ok := attachSet.Get(a.ContentID); ok {
+				a.Data = data
+			}
+		}
 	}
 	return httpResponse, nil
 }
 
-// Format the Soap Fault as indented string. Namespaces are dropped for better
-// readability. Tags with lower level than start level is omitted.
-func formatFaultXML(xmlBytes []byte, startLevel int) string {
-	indent := "	"
-	d := xml.NewDecoder(bytes.NewBuffer(xmlBytes))
-
-	level := 0
-	var out bytes.Buffer
-	out.Grow(len(xmlBytes))
-	ind := func() {
-		n := 0
-		if level-startLevel-1 > 0 {
-			n = level - startLevel - 1
-		}
-		out.Write([]byte(strings.Repeat(indent, n)))
+// verifyResponseTimestamp runs c.Security.VerifyTimestamp against the
+// <wsu:Timestamp> found in the response's <wsse:Security> header, if any.
+func (c *Client) verifyResponseTimestamp(respEnvelope *Envelope) error {
+	if respEnvelope.Header == nil || respEnvelope.Header.Security == nil || respEnvelope.Header.Security.Timestamp == nil {
+		return nil
 	}
-	lf := func() {
-		out.Write([]byte("\n"))
+	ts := respEnvelope.Header.Security.Timestamp
+	created, err := time.Parse(time.RFC3339, ts.Created)
+	if err != nil {
+		return fmt.Errorf("soap: parsing response wsu:Timestamp Created: %w", err)
 	}
-
-	lastWasStart := false
-	lastWasCharData := false
-	lastWasEnd := false
-
-	for token, err := d.Token(); token != nil && err == nil; token, err = d.Token() {
-		switch tt := token.(type) {
-		case xml.StartElement:
-			lastWasCharData = false
-
-			if lastWasEnd || lastWasStart {
-				lf()
-			}
-			lastWasStart = true
-			ind()
-			elementName := tt.Name.Local
-
-			if level > startLevel {
-				out.WriteString("<" + elementName)
-				out.WriteString(">")
-			}
-
-			level++
-			lastWasEnd = false
-		case xml.CharData:
-			lastWasCharData = true
-			_ = lastWasCharData
-			lastWasStart = false
-
-			xml.EscapeText(&out, tt)
-			lastWasEnd = false
-		case xml.EndElement:
-			level--
-			if lastWasEnd {
-				lf()
-				ind()
-			}
-			lastWasEnd = true
-			lastWasStart = false
-
-			if level > startLevel {
-				endTagName := tt.Name.Local
-				out.WriteString("</" + endTagName + ">")
-			}
-
-		}
+	expires, err := time.Parse(time.RFC3339, ts.Expires)
+	if err != nil {
+		return fmt.Errorf("soap: parsing response wsu:Timestamp Expires: %w", err)
 	}
-	return string(bytes.Trim(out.Bytes(), " \n"))
+	return c.Security.VerifyTimestamp(created, expires)
 }
 
 var (
 	soapPrefixTagUC = []byte("<SOAP")
 	soapPrefixTagLC = []byte("<soap")
 )
-
-func replaceSoap12to11(data []byte) []byte {
-	return bytes.ReplaceAll(data, bNamespaceSoap12, bNamespaceSoap11)
-}
-
-func replaceSoap11to12(data []byte) []byte {
-	return bytes.ReplaceAll(data, bNamespaceSoap11, bNamespaceSoap12)
-}
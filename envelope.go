@@ -0,0 +1,138 @@
+package soap
+
+import (
+	"encoding/xml"
+	"io"
+)
+
+// SOAP protocol versions supported by Client.
+const (
+	SoapVersion11 = "1.1"
+	SoapVersion12 = "1.2"
+)
+
+// Content-Type headers sent for each SOAP version.
+const (
+	SoapContentType11 = "text/xml; charset=utf-8"
+	SoapContentType12 = "application/soap+xml; charset=utf-8"
+)
+
+// Envelope namespaces. Element tags below are intentionally unqualified
+// (namespace-agnostic): encoding/xml matches unqualified tags by local
+// name only, so the same structs decode SOAP 1.1 and SOAP 1.2 responses
+// natively. On the way out, Envelope.Xmlns pins the declared default
+// namespace to whichever version the Client is using.
+const (
+	namespaceSoap11 = "http://schemas.xmlsoap.org/soap/envelope/"
+	namespaceSoap12 = "http://www.w3.org/2003/05/soap-envelope"
+)
+
+// Envelope is the outermost element of a SOAP request or response.
+type Envelope struct {
+	XMLName xml.Name `xml:"Envelope"`
+	Xmlns   string   `xml:"xmlns,attr"`
+	Header  *Header  `xml:"Header,omitempty"`
+	Body    Body     `xml:"Body"`
+}
+
+// Header carries out-of-band information, such as WS-Security tokens, that
+// travels alongside the Body. Content is marshalled as-is on outgoing
+// envelopes (see Client.Security). On incoming envelopes, UnmarshalXML
+// decodes only a <wsse:Security> element, into Security; every other
+// header element is skipped and Content is left untouched.
+type Header struct {
+	XMLName  xml.Name        `xml:"Header"`
+	Content  interface{}     `xml:",omitempty"`
+	Security *wsseSecurityIn `xml:"-"`
+}
+
+// UnmarshalXML implements xml.Unmarshaler, streaming the Header's
+// children and picking out a <wsse:Security> element (if any) without
+// requiring a destination type to be known ahead of time.
+func (h *Header) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
+	for {
+		tok, err := d.Token()
+		if err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+
+		switch t := tok.(type) {
+		case xml.StartElement:
+			if t.Name.Local == "Security" {
+				var sec wsseSecurityIn
+				if err := d.DecodeElement(&sec, &t); err != nil {
+					return err
+				}
+				h.Security = &sec
+				continue
+			}
+			if err := d.Skip(); err != nil {
+				return err
+			}
+		case xml.EndElement:
+			if t.Name.Local == start.Name.Local {
+				return nil
+			}
+		}
+	}
+}
+
+// Body wraps the operation request/response payload or, on failure, a
+// Fault. UnmarshalXML decodes both in a single pass straight off the
+// underlying stream, dispatching on the local name of the first child
+// element instead of buffering the whole envelope up front.
+type Body struct {
+	XMLName xml.Name    `xml:"Body"`
+	Fault   *Fault      `xml:"Fault,omitempty"`
+	Content interface{} `xml:",any"`
+}
+
+// UnmarshalXML implements xml.Unmarshaler, streaming the Body's single
+// child element directly into Content (or, if it is a <Fault>, into
+// Fault) without reading the rest of the response into memory first.
+func (b *Body) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
+	for {
+		tok, err := d.Token()
+		if err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+
+		switch t := tok.(type) {
+		case xml.StartElement:
+			if t.Name.Local == "Fault" {
+				var fault Fault
+				if err := d.DecodeElement(&fault, &t); err != nil {
+					return err
+				}
+				b.Fault = &fault
+				continue
+			}
+			if b.Content == nil {
+				if err := d.Skip(); err != nil {
+					return err
+				}
+				continue
+			}
+			if err := d.DecodeElement(b.Content, &t); err != nil {
+				return err
+			}
+		case xml.EndElement:
+			if t.Name.Local == start.Name.Local {
+				return nil
+			}
+		}
+	}
+}
+
+// dummyContent is used as the Body.Content placeholder when the caller
+// does not expect a response payload. Body.UnmarshalXML decodes a Fault
+// into Body.Fault whether or not Content is set.
+type dummyContent struct {
+	XMLName xml.Name `xml:"dummy"`
+}
@@ -0,0 +1,87 @@
+package soap
+
+import (
+	"encoding/xml"
+	"testing"
+)
+
+type envTestContent struct {
+	XMLName struct{} `xml:"Thing"`
+	Value   string   `xml:"Value"`
+}
+
+func TestEnvelopeRoundTripsSoap11AndSoap12(t *testing.T) {
+	for _, xmlns := range []string{namespaceSoap11, namespaceSoap12} {
+		env := Envelope{Xmlns: xmlns, Body: Body{Content: &envTestContent{Value: "hi"}}}
+		b, err := xml.Marshal(env)
+		if err != nil {
+			t.Fatalf("Marshal: %v", err)
+		}
+
+		var decoded Envelope
+		decoded.Body.Content = &envTestContent{}
+		if err := xml.Unmarshal(b, &decoded); err != nil {
+			t.Fatalf("Unmarshal: %v", err)
+		}
+		got := decoded.Body.Content.(*envTestContent)
+		if got.Value != "hi" {
+			t.Fatalf("xmlns %q: expected Value %q, got %q", xmlns, "hi", got.Value)
+		}
+	}
+}
+
+func TestBodyUnmarshalDecodesFaultInsteadOfContent(t *testing.T) {
+	raw := `<Envelope xmlns="http://schemas.xmlsoap.org/soap/envelope/">
+		<Body><Fault><faultcode>Server</faultcode><faultstring>boom</faultstring></Fault></Body>
+	</Envelope>`
+
+	env := &Envelope{Body: Body{Content: &envTestContent{}}}
+	if err := xml.Unmarshal([]byte(raw), env); err != nil {
+		t.Fatalf("Unmarshal: %v", err)
+	}
+	if env.Body.Fault == nil || env.Body.Fault.FaultString != "boom" {
+		t.Fatalf("expected decoded Fault, got %+v", env.Body.Fault)
+	}
+}
+
+func TestBodyUnmarshalSkipsContentWhenNil(t *testing.T) {
+	raw := `<Envelope xmlns="http://schemas.xmlsoap.org/soap/envelope/">
+		<Body><Thing><Value>hi</Value></Thing></Body>
+	</Envelope>`
+
+	// No Content destination set: Body.UnmarshalXML must skip the element
+	// instead of failing on a nil decode target.
+	env := &Envelope{}
+	if err := xml.Unmarshal([]byte(raw), env); err != nil {
+		t.Fatalf("Unmarshal: %v", err)
+	}
+	if env.Body.Fault != nil {
+		t.Fatalf("expected no Fault, got %+v", env.Body.Fault)
+	}
+}
+
+func TestHeaderUnmarshalFindsSecurityAmongOtherContent(t *testing.T) {
+	raw := `<Envelope xmlns="http://schemas.xmlsoap.org/soap/envelope/">
+		<Header>
+			<SomeOtherHeader><Foo>bar</Foo></SomeOtherHeader>
+			<Security xmlns="http://docs.oasis-open.org/wss/2004/01/oasis-200401-wss-wssecurity-secext-1.0.xsd">
+				<Timestamp xmlns="http://docs.oasis-open.org/wss/2004/01/oasis-200401-wss-wssecurity-utility-1.0.xsd">
+					<Created>2020-01-01T00:00:00Z</Created>
+					<Expires>2020-01-01T00:05:00Z</Expires>
+				</Timestamp>
+			</Security>
+		</Header>
+		<Body><Thing><Value>hi</Value></Thing></Body>
+	</Envelope>`
+
+	env := &Envelope{Body: Body{Content: &envTestContent{}}}
+	if err := xml.Unmarshal([]byte(raw), env); err != nil {
+		t.Fatalf("Unmarshal: %v", err)
+	}
+	if env.Header == nil || env.Header.Security == nil || env.Header.Security.Timestamp == nil {
+		t.Fatalf("expected decoded Security/Timestamp, got %+v", env.Header)
+	}
+	if env.Header.Security.Timestamp.Created != "2020-01-01T00:00:00Z" {
+		t.Fatalf("unexpected Timestamp.Created: %q", env.Header.Security.Timestamp.Created)
+	}
+}
@@ -0,0 +1,225 @@
+package soap
+
+import (
+	"encoding/xml"
+	"fmt"
+	"reflect"
+)
+
+// Fault is the raw, wire-level representation of a SOAP fault. It is
+// version-agnostic: SOAP 1.1 populates FaultCode/FaultString/FaultActor,
+// SOAP 1.2 populates Code/Reason/Node/Role. Call never returns a Fault
+// directly; it is decoded into a *SoapFault first.
+type Fault struct {
+	XMLName xml.Name `xml:"Fault"`
+
+	// SOAP 1.1
+	FaultCode   string `xml:"faultcode,omitempty"`
+	FaultString string `xml:"faultstring,omitempty"`
+	FaultActor  string `xml:"faultactor,omitempty"`
+
+	// SOAP 1.2
+	Code   *FaultCode   `xml:"Code"`
+	Reason *FaultReason `xml:"Reason"`
+	Node   string       `xml:"Node,omitempty"`
+	Role   string       `xml:"Role,omitempty"`
+
+	// Detail11/Detail12 are populated when marshalling a Fault the server
+	// is sending back (see Handler.writeFault); only one of them is set,
+	// matching the active SOAP version.
+	Detail11 *rawDetailElement `xml:"detail,omitempty"`
+	Detail12 *rawDetailElement `xml:"Detail,omitempty"`
+
+	// rawDetail holds the inner XML of <detail>/<Detail> verbatim, so it
+	// can be unmarshalled into a concrete type registered via
+	// Client.RegisterFaultDetail once the operation that produced it is
+	// known.
+	rawDetail []byte
+}
+
+// rawDetailElement wraps the arbitrary, caller-supplied contents of a
+// <detail>/<Detail> element for marshalling.
+type rawDetailElement struct {
+	Inner []byte `xml:",innerxml"`
+}
+
+// FaultCode is the SOAP 1.2 <Code> element, which may carry a chain of
+// <Subcode> elements refining it.
+type FaultCode struct {
+	Value   string        `xml:"Value"`
+	Subcode *FaultSubcode `xml:"Subcode"`
+}
+
+// FaultSubcode is a (possibly nested) SOAP 1.2 <Subcode> element.
+type FaultSubcode struct {
+	Value   string        `xml:"Value"`
+	Subcode *FaultSubcode `xml:"Subcode"`
+}
+
+// FaultReason is the SOAP 1.2 <Reason> element, which holds one or more
+// human-readable <Text xml:lang="..."> entries. Only one is kept: when the
+// server sends several, Text holds the last one.
+type FaultReason struct {
+	Text FaultReasonText `xml:"Text"`
+}
+
+// FaultReasonText is a single <Text xml:lang="..."> entry of a Reason.
+type FaultReasonText struct {
+	Value string `xml:",chardata"`
+	Lang  string `xml:"lang,attr"`
+}
+
+// UnmarshalXML decodes a <Fault> element from either SOAP version and
+// stashes the raw <detail>/<Detail> inner XML (if any) for later typed
+// decoding by Client.Call.
+func (f *Fault) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
+	type fault11 struct {
+		FaultCode   string `xml:"faultcode"`
+		FaultString string `xml:"faultstring"`
+		FaultActor  string `xml:"faultactor"`
+		Detail      struct {
+			Raw []byte `xml:",innerxml"`
+		} `xml:"detail"`
+	}
+	type fault12 struct {
+		Code   *FaultCode   `xml:"Code"`
+		Reason *FaultReason `xml:"Reason"`
+		Node   string       `xml:"Node"`
+		Role   string       `xml:"Role"`
+		Detail struct {
+			Raw []byte `xml:",innerxml"`
+		} `xml:"Detail"`
+	}
+
+	// xml.Decoder can only consume start once, so decode into both shapes
+	// via a single pass by re-reading the element's raw tokens.
+	var raw struct {
+		XMLName xml.Name `xml:"Fault"`
+		Inner   []byte   `xml:",innerxml"`
+	}
+	if err := d.DecodeElement(&raw, &start); err != nil {
+		return err
+	}
+
+	var f11 fault11
+	if err := xml.Unmarshal(wrapElement("Fault", raw.Inner), &f11); err != nil {
+		return err
+	}
+	var f12 fault12
+	if err := xml.Unmarshal(wrapElement("Fault", raw.Inner), &f12); err != nil {
+		return err
+	}
+
+	f.XMLName = raw.XMLName
+	f.FaultCode = f11.FaultCode
+	f.FaultString = f11.FaultString
+	f.FaultActor = f11.FaultActor
+	f.Code = f12.Code
+	f.Reason = f12.Reason
+	f.Node = f12.Node
+	f.Role = f12.Role
+
+	if len(f11.Detail.Raw) > 0 {
+		f.rawDetail = f11.Detail.Raw
+	} else if len(f12.Detail.Raw) > 0 {
+		f.rawDetail = f12.Detail.Raw
+	}
+	return nil
+}
+
+// wrapElement re-wraps innerXML in a synthetic root so it can be
+// unmarshalled a second time with a different target struct.
+func wrapElement(name string, inner []byte) []byte {
+	out := make([]byte, 0, len(inner)+2*len(name)+5)
+	out = append(out, '<')
+	out = append(out, name...)
+	out = append(out, '>')
+	out = append(out, inner...)
+	out = append(out, '<', '/')
+	out = append(out, name...)
+	out = append(out, '>')
+	return out
+}
+
+// SoapFault is the error returned by Client.Call when the server responds
+// with a SOAP Fault. It normalizes the SOAP 1.1 faultcode/faultstring/
+// faultactor triple and the SOAP 1.2 Code/Reason/Node/Role elements, and
+// decodes <detail>/<Detail> into a concrete type when the operation
+// registered one via Client.RegisterFaultDetail.
+type SoapFault struct {
+	// SOAP 1.1
+	FaultCode   string
+	FaultString string
+	FaultActor  string
+
+	// SOAP 1.2
+	Code   *FaultCode
+	Reason string
+	Lang   string
+	Node   string
+	Role   string
+
+	// Detail is the decoded <detail>/<Detail> payload. It is a pointer to
+	// the type registered for the operation via RegisterFaultDetail, or
+	// the raw []byte of the element's inner XML if no type was
+	// registered (or decoding into it failed).
+	Detail interface{}
+}
+
+// Error implements the error interface.
+func (f *SoapFault) Error() string {
+	switch {
+	case f.FaultString != "":
+		return fmt.Sprintf("soap fault %s: %s", f.FaultCode, f.FaultString)
+	case f.Reason != "":
+		code := ""
+		if f.Code != nil {
+			code = f.Code.Value
+		}
+		return fmt.Sprintf("soap fault %s: %s", code, f.Reason)
+	default:
+		return "soap fault"
+	}
+}
+
+// newSoapFault builds a *SoapFault from the raw wire Fault, decoding its
+// detail payload into the type registered for soapAction, if any.
+func (c *Client) newSoapFault(soapAction string, raw *Fault) *SoapFault {
+	sf := &SoapFault{
+		FaultCode:   raw.FaultCode,
+		FaultString: raw.FaultString,
+		FaultActor:  raw.FaultActor,
+		Code:        raw.Code,
+		Node:        raw.Node,
+		Role:        raw.Role,
+	}
+	if raw.Reason != nil {
+		sf.Reason = raw.Reason.Text.Value
+		sf.Lang = raw.Reason.Text.Lang
+	}
+
+	if len(raw.rawDetail) == 0 {
+		return sf
+	}
+
+	if t, ok := c.faultDetailTypes[soapAction]; ok {
+		detail := reflect.New(t).Interface()
+		if err := xml.Unmarshal(raw.rawDetail, detail); err == nil {
+			sf.Detail = detail
+			return sf
+		}
+	}
+	sf.Detail = raw.rawDetail
+	return sf
+}
+
+// RegisterFaultDetail associates a concrete type with soapAction so that
+// Call can unmarshal the <detail>/<Detail> element of a fault returned for
+// that operation into the type, instead of leaving SoapFault.Detail as raw
+// bytes. t is typically obtained via reflect.TypeOf(MyFaultDetail{}).
+func (c *Client) RegisterFaultDetail(soapAction string, t reflect.Type) {
+	if c.faultDetailTypes == nil {
+		c.faultDetailTypes = make(map[string]reflect.Type)
+	}
+	c.faultDetailTypes[soapAction] = t
+}
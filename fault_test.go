@@ -0,0 +1,102 @@
+package soap
+
+import (
+	"encoding/xml"
+	"reflect"
+	"testing"
+)
+
+func TestFaultUnmarshalSoap11(t *testing.T) {
+	raw := `<Fault>
+		<faultcode>Server</faultcode>
+		<faultstring>something broke</faultstring>
+		<faultactor>http://example.com/actor</faultactor>
+		<detail><Reason>overloaded</Reason></detail>
+	</Fault>`
+
+	var f Fault
+	if err := xml.Unmarshal([]byte(raw), &f); err != nil {
+		t.Fatalf("Unmarshal: %v", err)
+	}
+	if f.FaultCode != "Server" || f.FaultString != "something broke" || f.FaultActor != "http://example.com/actor" {
+		t.Fatalf("unexpected SOAP 1.1 fields: %+v", f)
+	}
+	if f.Code != nil || f.Reason != nil {
+		t.Fatalf("expected SOAP 1.2 fields to stay empty, got Code=%v Reason=%v", f.Code, f.Reason)
+	}
+	if string(f.rawDetail) != "<Reason>overloaded</Reason>" {
+		t.Fatalf("unexpected rawDetail: %q", f.rawDetail)
+	}
+}
+
+func TestFaultUnmarshalSoap12(t *testing.T) {
+	raw := `<Fault>
+		<Code><Value>Sender</Value><Subcode><Value>InvalidInput</Value></Subcode></Code>
+		<Reason><Text xml:lang="en">bad request</Text></Reason>
+		<Node>http://example.com/node</Node>
+		<Role>http://example.com/role</Role>
+		<Detail><Reason>field X missing</Reason></Detail>
+	</Fault>`
+
+	var f Fault
+	if err := xml.Unmarshal([]byte(raw), &f); err != nil {
+		t.Fatalf("Unmarshal: %v", err)
+	}
+	if f.FaultCode != "" || f.FaultString != "" {
+		t.Fatalf("expected SOAP 1.1 fields to stay empty, got %+v", f)
+	}
+	if f.Code == nil || f.Code.Value != "Sender" {
+		t.Fatalf("unexpected Code: %+v", f.Code)
+	}
+	if f.Code.Subcode == nil || f.Code.Subcode.Value != "InvalidInput" {
+		t.Fatalf("unexpected Subcode: %+v", f.Code.Subcode)
+	}
+	if f.Reason == nil || f.Reason.Text.Value != "bad request" || f.Reason.Text.Lang != "en" {
+		t.Fatalf("unexpected Reason: %+v", f.Reason)
+	}
+	if f.Node != "http://example.com/node" || f.Role != "http://example.com/role" {
+		t.Fatalf("unexpected Node/Role: %q / %q", f.Node, f.Role)
+	}
+	if string(f.rawDetail) != "<Reason>field X missing</Reason>" {
+		t.Fatalf("unexpected rawDetail: %q", f.rawDetail)
+	}
+}
+
+type testFaultDetail struct {
+	XMLName xml.Name `xml:"Reason"`
+	Text    string   `xml:",chardata"`
+}
+
+func TestNewSoapFaultDecodesRegisteredDetail(t *testing.T) {
+	c := NewClient("http://example.com", nil)
+	c.RegisterFaultDetail("DoThing", reflect.TypeOf(testFaultDetail{}))
+
+	raw := &Fault{FaultCode: "Server", FaultString: "boom", rawDetail: []byte("<Reason>overloaded</Reason>")}
+	sf := c.newSoapFault("DoThing", raw)
+
+	detail, ok := sf.Detail.(*testFaultDetail)
+	if !ok {
+		t.Fatalf("expected *testFaultDetail, got %T", sf.Detail)
+	}
+	if detail.Text != "overloaded" {
+		t.Fatalf("unexpected detail: %+v", detail)
+	}
+	if sf.Error() != "soap fault Server: boom" {
+		t.Fatalf("unexpected Error(): %q", sf.Error())
+	}
+}
+
+func TestNewSoapFaultFallsBackToRawDetail(t *testing.T) {
+	c := NewClient("http://example.com", nil)
+
+	raw := &Fault{FaultCode: "Server", FaultString: "boom", rawDetail: []byte("<Reason>overloaded</Reason>")}
+	sf := c.newSoapFault("Unregistered", raw)
+
+	detail, ok := sf.Detail.([]byte)
+	if !ok {
+		t.Fatalf("expected []byte, got %T", sf.Detail)
+	}
+	if string(detail) != "<Reason>overloaded</Reason>" {
+		t.Fatalf("unexpected raw detail: %q", detail)
+	}
+}
@@ -0,0 +1,292 @@
+package soap
+
+import (
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"reflect"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Invoker performs a single SOAP request/response exchange. It is what an
+// Interceptor calls into to continue the chain.
+type Invoker func(ctx context.Context, request, response interface{}) (*http.Response, error)
+
+// Interceptor wraps a Call, observing or altering behaviour around next.
+// op is the SOAPAction the call was made with. Interceptors registered via
+// Client.Use run in the order they were added, outermost first.
+type Interceptor func(ctx context.Context, op string, request, response interface{}, next Invoker) (*http.Response, error)
+
+// Use appends interceptors to the chain that Call runs every request
+// through, outermost first. RequestHeaderFn, Log and HTTPClientDoFn stay
+// plain Client fields for simple configuration, but Call wires them into
+// this same chain as a default, innermost set (see
+// Client.defaultInterceptors) rather than applying them separately, so a
+// retry or other interceptor added via Use re-runs them on every attempt
+// in one coherent order instead of two independent mechanisms.
+func (c *Client) Use(interceptors ...Interceptor) {
+	c.interceptors = append(c.interceptors, interceptors...)
+}
+
+// requestHeaderInterceptor reimplements the legacy RequestHeaderFn field
+// as a default interceptor: it records fn on the call's requestContext so
+// doCall applies it to the outgoing request's header, wherever doCall
+// lands in the chain (e.g. on every attempt of a wrapping retry).
+func requestHeaderInterceptor(fn func(http.Header)) Interceptor {
+	return func(ctx context.Context, op string, request, response interface{}, next Invoker) (*http.Response, error) {
+		if fn != nil {
+			if rc := requestContextFrom(ctx); rc != nil {
+				rc.headerFn = fn
+			}
+		}
+		return next(ctx, request, response)
+	}
+}
+
+// httpDoInterceptor reimplements the legacy HTTPClientDoFn field as a
+// default interceptor, the same way requestHeaderInterceptor does for
+// RequestHeaderFn.
+func httpDoInterceptor(fn func(*http.Request) (*http.Response, error)) Interceptor {
+	return func(ctx context.Context, op string, request, response interface{}, next Invoker) (*http.Response, error) {
+		if fn != nil {
+			if rc := requestContextFrom(ctx); rc != nil {
+				rc.httpDoFn = fn
+			}
+		}
+		return next(ctx, request, response)
+	}
+}
+
+// isTransient reports whether err represents a failure worth retrying: a
+// transient HTTP 5xx response, or a soap:Server/soap:Receiver fault. A
+// call that returned no error already produced a usable response, no
+// matter what HTTP status it travelled in on, and is never transient.
+func isTransient(resp *http.Response, err error) bool {
+	if err == nil {
+		return false
+	}
+	var sf *SoapFault
+	if errors.As(err, &sf) {
+		// Fault codes are QNames such as "soap:Server"; compare the local part.
+		local := func(qname string) string {
+			return qname[strings.LastIndex(qname, ":")+1:]
+		}
+		return local(sf.FaultCode) == "Server" || (sf.Code != nil && local(sf.Code.Value) == "Receiver")
+	}
+	return resp != nil && resp.StatusCode >= 500
+}
+
+// resetResponse zeroes out *response so a retried call doesn't decode
+// into a value already partially populated by a discarded attempt -
+// encoding/xml.Unmarshal never clears fields absent from a document, so
+// without this a field set by a failed attempt could silently survive
+// into the result of a later, accepted one.
+func resetResponse(response interface{}) {
+	rv := reflect.ValueOf(response)
+	if rv.Kind() == reflect.Ptr && !rv.IsNil() {
+		rv.Elem().Set(reflect.Zero(rv.Elem().Type()))
+	}
+}
+
+// RetryInterceptor retries a call up to maxAttempts times when it fails
+// with a transient HTTP 5xx response or a soap:Server/soap:Receiver
+// fault, waiting baseDelay*2^attempt (plus jitter) between attempts.
+func RetryInterceptor(maxAttempts int, baseDelay time.Duration) Interceptor {
+	return func(ctx context.Context, op string, request, response interface{}, next Invoker) (*http.Response, error) {
+		var httpResp *http.Response
+		var err error
+		for attempt := 0; attempt < maxAttempts; attempt++ {
+			if attempt > 0 {
+				resetResponse(response)
+			}
+			httpResp, err = next(ctx, request, response)
+			if !isTransient(httpResp, err) || attempt == maxAttempts-1 {
+				return httpResp, err
+			}
+			delay := baseDelay * (1 << attempt)
+			delay += time.Duration(rand.Int63n(int64(delay)/2 + 1))
+			select {
+			case <-time.After(delay):
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			}
+		}
+		return httpResp, err
+	}
+}
+
+// Span is the minimal subset of a tracing span that TracingInterceptor
+// needs. It is deliberately shaped to match
+// go.opentelemetry.io/otel/trace.Span closely enough to adapt directly,
+// without this package depending on a specific tracing SDK.
+type Span interface {
+	SetAttribute(key string, value interface{})
+	SetStatusError(description string)
+	End()
+}
+
+// Tracer starts a Span named name, returning a context carrying it. It
+// matches the shape of go.opentelemetry.io/otel/trace.Tracer.Start
+// closely enough to adapt directly.
+type Tracer func(ctx context.Context, name string) (context.Context, Span)
+
+// TracingInterceptor starts a span per SOAPAction via tracer, recording
+// the fault code of a SOAP fault (if any) as a span attribute and
+// marking the span's status as an error.
+func TracingInterceptor(tracer Tracer) Interceptor {
+	return func(ctx context.Context, op string, request, response interface{}, next Invoker) (*http.Response, error) {
+		ctx, span := tracer(ctx, op)
+		defer span.End()
+
+		httpResp, err := next(ctx, request, response)
+
+		var sf *SoapFault
+		if errors.As(err, &sf) {
+			code := sf.FaultCode
+			if code == "" && sf.Code != nil {
+				code = sf.Code.Value
+			}
+			span.SetAttribute("soap.fault_code", code)
+			span.SetStatusError(sf.Error())
+		} else if err != nil {
+			span.SetStatusError(err.Error())
+		}
+		return httpResp, err
+	}
+}
+
+// Metrics is the minimal recorder MetricsInterceptor reports to. Adapt a
+// github.com/prometheus/client_golang HistogramVec/CounterVec pair (or
+// any other backend) to this interface, without this package depending
+// on a specific metrics SDK.
+type Metrics interface {
+	ObserveLatency(op string, d time.Duration)
+	IncFaultCount(op, faultCode string)
+}
+
+// MetricsInterceptor records call latency and, on a SOAP fault,
+// increments a fault counter keyed by fault code.
+func MetricsInterceptor(m Metrics) Interceptor {
+	return func(ctx context.Context, op string, request, response interface{}, next Invoker) (*http.Response, error) {
+		start := time.Now()
+		httpResp, err := next(ctx, request, response)
+		m.ObserveLatency(op, time.Since(start))
+
+		var sf *SoapFault
+		if errors.As(err, &sf) {
+			code := sf.FaultCode
+			if code == "" && sf.Code != nil {
+				code = sf.Code.Value
+			}
+			m.IncFaultCount(op, code)
+		}
+		return httpResp, err
+	}
+}
+
+// defaultRedactPatterns is used by LoggingInterceptor when no patterns
+// are given; it redacts the contents of a <wsse:Password> element.
+var defaultRedactPatterns = []*regexp.Regexp{
+	regexp.MustCompile(`(?s)(<[\w:]*Password[^>]*>).*?(</[\w:]*Password>)`),
+}
+
+// LoggingInterceptor logs the marshalled request and response of every
+// call via log, redacting any text matched by patterns. If patterns is
+// empty, it redacts the contents of every element whose name ends in
+// Password, such as <wsse:Password>. The logged request is the
+// actual envelope doCall put on the wire - including a <wsse:Security>
+// header from Client.Security - rather than the typed request value this
+// interceptor is called with, since that's the only place a WS-Security
+// password ever appears; the response is logged as the typed value, since
+// doCall streams it straight off the HTTP body and never re-marshals it.
+func LoggingInterceptor(log func(...interface{}), patterns ...*regexp.Regexp) Interceptor {
+	if len(patterns) == 0 {
+		patterns = defaultRedactPatterns
+	}
+	redact := func(s string) string {
+		for _, p := range patterns {
+			s = p.ReplaceAllString(s, "$1***REDACTED***$2")
+		}
+		return s
+	}
+	redactValue := func(v interface{}) string {
+		b, err := xml.MarshalIndent(v, "", "  ")
+		if err != nil {
+			return fmt.Sprintf("<could not marshal for logging: %s>", err)
+		}
+		return redact(string(b))
+	}
+	return func(ctx context.Context, op string, request, response interface{}, next Invoker) (*http.Response, error) {
+		httpResp, err := next(ctx, request, response)
+
+		requestXML := "<unavailable>"
+		if rc := requestContextFrom(ctx); rc != nil && rc.requestXML != nil {
+			requestXML = redact(string(rc.requestXML))
+		}
+		log("soap: call", op, "request:\n"+requestXML)
+		log("soap: call", op, "response:\n"+redactValue(response), "err:", err)
+		return httpResp, err
+	}
+}
+
+// CircuitBreaker trips after FailureThreshold consecutive failures
+// (transient HTTP 5xx responses or errors) and, for ResetTimeout after
+// that, rejects calls without invoking next. After ResetTimeout elapses
+// it lets a single trial call through to test whether the dependency has
+// recovered.
+type CircuitBreaker struct {
+	FailureThreshold int
+	ResetTimeout     time.Duration
+
+	mu       sync.Mutex
+	failures int
+	openedAt time.Time
+	open     bool
+}
+
+// NewCircuitBreaker constructs a CircuitBreaker tripping after
+// failureThreshold consecutive failures, staying open for resetTimeout.
+func NewCircuitBreaker(failureThreshold int, resetTimeout time.Duration) *CircuitBreaker {
+	return &CircuitBreaker{FailureThreshold: failureThreshold, ResetTimeout: resetTimeout}
+}
+
+// Intercept implements Interceptor; register it via Client.Use(cb.Intercept).
+func (cb *CircuitBreaker) Intercept(ctx context.Context, op string, request, response interface{}, next Invoker) (*http.Response, error) {
+	cb.mu.Lock()
+	trial := false
+	if cb.open {
+		if time.Since(cb.openedAt) < cb.ResetTimeout {
+			cb.mu.Unlock()
+			return nil, fmt.Errorf("soap: circuit breaker open for %q", op)
+		}
+		// half-open: let one trial call through, and keep rejecting others
+		// for another ResetTimeout while it runs
+		trial = true
+		cb.openedAt = time.Now()
+	}
+	cb.mu.Unlock()
+
+	httpResp, err := next(ctx, request, response)
+
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	if isTransient(httpResp, err) || err != nil {
+		cb.failures++
+		if cb.failures >= cb.FailureThreshold || trial {
+			cb.open = true
+			cb.openedAt = time.Now()
+		}
+	} else {
+		cb.failures = 0
+		if trial {
+			cb.open = false
+		}
+	}
+	return httpResp, err
+}
@@ -0,0 +1,171 @@
+package soap
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+type mwRequest struct {
+	XMLName struct{} `xml:"Req"`
+}
+type mwResponse struct {
+	XMLName struct{} `xml:"Resp"`
+	A       string   `xml:"A"`
+	B       string   `xml:"B"`
+}
+
+func TestUseRunsInterceptorsOutermostFirst(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`<Envelope xmlns="http://schemas.xmlsoap.org/soap/envelope/"><Body><Resp/></Body></Envelope>`))
+	}))
+	defer srv.Close()
+
+	var order []string
+	mark := func(name string) Interceptor {
+		return func(ctx context.Context, op string, request, response interface{}, next Invoker) (*http.Response, error) {
+			order = append(order, name+":before")
+			resp, err := next(ctx, request, response)
+			order = append(order, name+":after")
+			return resp, err
+		}
+	}
+
+	c := NewClient(srv.URL, nil)
+	c.Use(mark("outer"), mark("inner"))
+
+	var resp mwResponse
+	if _, err := c.Call(context.Background(), "DoThing", &mwRequest{}, &resp); err != nil {
+		t.Fatalf("Call: %v", err)
+	}
+
+	want := []string{"outer:before", "inner:before", "inner:after", "outer:after"}
+	if len(order) != len(want) {
+		t.Fatalf("unexpected order: %v", order)
+	}
+	for i := range want {
+		if order[i] != want[i] {
+			t.Fatalf("unexpected order: %v", order)
+		}
+	}
+}
+
+func TestRetryInterceptorRetriesTransientFaultAndResetsResponse(t *testing.T) {
+	attempts := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		if attempts == 1 {
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Write([]byte(`<Envelope xmlns="http://schemas.xmlsoap.org/soap/envelope/"><Body><Fault><faultcode>Server</faultcode><faultstring>boom</faultstring></Fault></Body></Envelope>`))
+			return
+		}
+		w.Write([]byte(`<Envelope xmlns="http://schemas.xmlsoap.org/soap/envelope/"><Body><Resp><A>second-A</A></Resp></Body></Envelope>`))
+	}))
+	defer srv.Close()
+
+	c := NewClient(srv.URL, nil)
+	c.Use(RetryInterceptor(3, time.Millisecond))
+
+	resp := mwResponse{B: "stale"}
+	if _, err := c.Call(context.Background(), "DoThing", &mwRequest{}, &resp); err != nil {
+		t.Fatalf("Call: %v", err)
+	}
+	if attempts != 2 {
+		t.Fatalf("expected exactly one retry, got %d attempts", attempts)
+	}
+	if resp.A != "second-A" || resp.B != "" {
+		t.Fatalf("expected a clean decode of the second attempt, got %+v", resp)
+	}
+}
+
+func TestRetryInterceptorDoesNotRetrySuccessfulCall(t *testing.T) {
+	attempts := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		w.WriteHeader(http.StatusInternalServerError)                                                                                 // transient-looking status...
+		w.Write([]byte(`<Envelope xmlns="http://schemas.xmlsoap.org/soap/envelope/"><Body><Resp><A>ok</A></Resp></Body></Envelope>`)) // ...but a full, valid body
+	}))
+	defer srv.Close()
+
+	c := NewClient(srv.URL, nil)
+	c.Use(RetryInterceptor(3, time.Millisecond))
+
+	var resp mwResponse
+	if _, err := c.Call(context.Background(), "DoThing", &mwRequest{}, &resp); err != nil {
+		t.Fatalf("Call: %v", err)
+	}
+	if attempts != 1 {
+		t.Fatalf("expected no retry on a successful decode, got %d attempts", attempts)
+	}
+}
+
+func TestCircuitBreakerOpensAfterThreshold(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write([]byte(`<Envelope xmlns="http://schemas.xmlsoap.org/soap/envelope/"><Body><Fault><faultcode>Server</faultcode><faultstring>down</faultstring></Fault></Body></Envelope>`))
+	}))
+	defer srv.Close()
+
+	c := NewClient(srv.URL, nil)
+	cb := NewCircuitBreaker(2, time.Hour)
+	c.Use(cb.Intercept)
+
+	var resp mwResponse
+	for i := 0; i < 2; i++ {
+		if _, err := c.Call(context.Background(), "DoThing", &mwRequest{}, &resp); err == nil {
+			t.Fatalf("expected call %d to fail", i)
+		}
+	}
+
+	_, err := c.Call(context.Background(), "DoThing", &mwRequest{}, &resp)
+	if err == nil {
+		t.Fatal("expected the circuit breaker to reject the call")
+	}
+	if err.Error() != `soap: circuit breaker open for "DoThing"` {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestLoggingInterceptorRedactsPassword(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`<Envelope xmlns="http://schemas.xmlsoap.org/soap/envelope/"><Body><Resp/></Body></Envelope>`))
+	}))
+	defer srv.Close()
+
+	c := NewClient(srv.URL, nil)
+	c.Security = &Security{Tokens: []SecurityToken{&UsernameToken{Username: "alice", Password: "s3cret"}}}
+
+	var logged []string
+	c.Use(LoggingInterceptor(func(v ...interface{}) {
+		for _, p := range v {
+			if s, ok := p.(string); ok {
+				logged = append(logged, s)
+			}
+		}
+	}))
+
+	var resp mwResponse
+	if _, err := c.Call(context.Background(), "DoThing", &mwRequest{}, &resp); err != nil {
+		t.Fatalf("Call: %v", err)
+	}
+
+	sawSecurityHeader := false
+	for _, l := range logged {
+		if strings.Contains(l, "wsse:Security") {
+			sawSecurityHeader = true
+		}
+		if strings.Contains(l, "s3cret") {
+			t.Fatalf("logged output leaked the password: %s", l)
+		}
+	}
+	// Without this, the loop above would pass vacuously: LoggingInterceptor
+	// must actually be logging the marshalled <wsse:Security> header (where
+	// the password lives), not just the typed request/response values that
+	// never carry it in the first place.
+	if !sawSecurityHeader {
+		t.Fatalf("expected logged output to include the envelope's Security header, got: %v", logged)
+	}
+}
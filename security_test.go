@@ -0,0 +1,109 @@
+package soap
+
+import (
+	"encoding/xml"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestUsernameTokenPasswordText(t *testing.T) {
+	tok := &UsernameToken{Username: "alice", Password: "secret"}
+	x, err := tok.TokenXML()
+	if err != nil {
+		t.Fatalf("TokenXML: %v", err)
+	}
+	wut := x.(*wsseUsernameToken)
+	if wut.Username != "alice" || wut.Password.Value != "secret" || wut.Password.Type != passwordTextType {
+		t.Fatalf("unexpected token: %+v", wut)
+	}
+	if wut.Nonce != nil || wut.Created != "" {
+		t.Fatalf("PasswordText should not set Nonce/Created: %+v", wut)
+	}
+}
+
+func TestUsernameTokenPasswordDigest(t *testing.T) {
+	tok := &UsernameToken{Username: "alice", Password: "secret", PasswordDigest: true}
+	x, err := tok.TokenXML()
+	if err != nil {
+		t.Fatalf("TokenXML: %v", err)
+	}
+	wut := x.(*wsseUsernameToken)
+	if wut.Password.Type != passwordDigestType {
+		t.Fatalf("expected digest type, got %q", wut.Password.Type)
+	}
+	if wut.Nonce == nil || wut.Nonce.Value == "" || wut.Created == "" {
+		t.Fatalf("digest mode must set Nonce and Created: %+v", wut)
+	}
+	if wut.Password.Value == "secret" {
+		t.Fatalf("digest mode must not send the plaintext password")
+	}
+}
+
+func TestTimestampTokenXMLDefaultTTL(t *testing.T) {
+	ts := &Timestamp{}
+	x, err := ts.TokenXML()
+	if err != nil {
+		t.Fatalf("TokenXML: %v", err)
+	}
+	wt := x.(*wsuTimestamp)
+	created, err := time.Parse(time.RFC3339, wt.Created)
+	if err != nil {
+		t.Fatalf("parsing Created: %v", err)
+	}
+	expires, err := time.Parse(time.RFC3339, wt.Expires)
+	if err != nil {
+		t.Fatalf("parsing Expires: %v", err)
+	}
+	if d := expires.Sub(created); d != 5*time.Minute {
+		t.Fatalf("expected default TTL of 5m, got %s", d)
+	}
+}
+
+func TestSecurityHeaderNamespacesElements(t *testing.T) {
+	sec := &Security{Tokens: []SecurityToken{
+		&UsernameToken{Username: "alice", Password: "secret"},
+		&Timestamp{TTL: time.Minute},
+	}}
+	hdr, err := sec.securityHeader()
+	if err != nil {
+		t.Fatalf("securityHeader: %v", err)
+	}
+	b, err := xml.Marshal(hdr)
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+	out := string(b)
+	for _, want := range []string{
+		`<wsse:Security xmlns:wsse="` + namespaceWSSE + `" xmlns:wsu="` + namespaceWSU + `">`,
+		"<wsse:UsernameToken>",
+		"<wsse:Username>alice</wsse:Username>",
+		"<wsu:Timestamp>",
+	} {
+		if !strings.Contains(out, want) {
+			t.Fatalf("expected marshalled header to contain %q, got:\n%s", want, out)
+		}
+	}
+}
+
+func TestHeaderUnmarshalDecodesTimestampForVerification(t *testing.T) {
+	raw := `<Header>
+		<Security xmlns="` + namespaceWSSE + `">
+			<Timestamp xmlns="` + namespaceWSU + `">
+				<Created>2020-01-01T00:00:00Z</Created>
+				<Expires>2020-01-01T00:05:00Z</Expires>
+			</Timestamp>
+		</Security>
+	</Header>`
+
+	var h Header
+	if err := xml.Unmarshal([]byte(raw), &h); err != nil {
+		t.Fatalf("Unmarshal: %v", err)
+	}
+	if h.Security == nil || h.Security.Timestamp == nil {
+		t.Fatalf("expected decoded Security/Timestamp, got %+v", h.Security)
+	}
+	if h.Security.Timestamp.Created != "2020-01-01T00:00:00Z" || h.Security.Timestamp.Expires != "2020-01-01T00:05:00Z" {
+		t.Fatalf("unexpected Timestamp: %+v", h.Security.Timestamp)
+	}
+}
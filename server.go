@@ -0,0 +1,242 @@
+package soap
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"fmt"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"reflect"
+	"strings"
+)
+
+var ctxType = reflect.TypeOf((*context.Context)(nil)).Elem()
+var errType = reflect.TypeOf((*error)(nil)).Elem()
+
+// ServiceFault is the error type a registered operation returns to control
+// exactly what fault is sent back to the caller. Returning any other error
+// produces a generic "Server"/"Receiver" fault carrying err.Error() as the
+// reason.
+type ServiceFault struct {
+	Code    string // e.g. "Client"/"Server" (SOAP 1.1) or "Sender"/"Receiver" (SOAP 1.2)
+	Subcode string // SOAP 1.2 only
+	Reason  string
+	Detail  interface{} // marshalled into <detail>/<Detail>, if non-nil
+}
+
+// Error implements the error interface.
+func (f *ServiceFault) Error() string {
+	return f.Reason
+}
+
+// operation is a registered handler bound to a SOAPAction.
+type operation struct {
+	fn      reflect.Value
+	reqType reflect.Type // e.g. *FooRequest
+}
+
+// Handler dispatches incoming SOAP 1.1 and 1.2 requests to operations
+// registered via RegisterOperation. It implements http.Handler and can be
+// mounted directly on an http.Server.
+type Handler struct {
+	operations map[string]operation
+}
+
+// NewHandler constructs an empty Handler.
+func NewHandler() *Handler {
+	return &Handler{operations: make(map[string]operation)}
+}
+
+// RegisterOperation binds soapAction to fn, which must have the signature
+// func(ctx context.Context, req *ReqT) (*RespT, error). It panics if fn
+// does not match that signature, since a mismatch is a programming error
+// caught at startup rather than something to recover from at request time.
+func (h *Handler) RegisterOperation(soapAction string, fn interface{}) {
+	v := reflect.ValueOf(fn)
+	t := v.Type()
+	if t.Kind() != reflect.Func || t.NumIn() != 2 || t.NumOut() != 2 ||
+		t.In(0) != ctxType || t.In(1).Kind() != reflect.Ptr || t.Out(0).Kind() != reflect.Ptr || t.Out(1) != errType {
+		panic(fmt.Sprintf("soap: RegisterOperation(%q): fn must be func(context.Context, *ReqT) (*RespT, error)", soapAction))
+	}
+	h.operations[soapAction] = operation{fn: v, reqType: t.In(1)}
+}
+
+// ServeHTTP implements http.Handler.
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	mediaType, params, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	version := SoapVersion11
+	soapAction := strings.Trim(r.Header.Get("SOAPAction"), `"`)
+	if mediaType == "application/soap+xml" {
+		version = SoapVersion12
+		if soapAction == "" {
+			soapAction = strings.Trim(params["action"], `"`)
+		}
+	}
+
+	op, ok := h.operations[soapAction]
+	if !ok {
+		h.writeFault(w, version, &ServiceFault{Code: "Client", Reason: "soap: unknown operation " + soapAction})
+		return
+	}
+
+	req := reflect.New(op.reqType.Elem())
+	envelope := &Envelope{Body: Body{Content: req.Interface()}}
+	if err := xml.NewDecoder(r.Body).Decode(envelope); err != nil {
+		h.writeFault(w, version, &ServiceFault{Code: "Client", Reason: err.Error()})
+		return
+	}
+
+	cs := &callState{}
+	ctx := context.WithValue(r.Context(), callStateKey, cs)
+	out := op.fn.Call([]reflect.Value{reflect.ValueOf(ctx), req})
+	if errVal, _ := out[1].Interface().(error); errVal != nil {
+		h.writeFault(w, version, errVal)
+		return
+	}
+
+	h.writeResponse(w, version, out[0].Interface(), cs)
+}
+
+func (h *Handler) writeFault(w http.ResponseWriter, version string, err error) {
+	sf, ok := err.(*ServiceFault)
+	if !ok {
+		sf = &ServiceFault{Code: "Server", Reason: err.Error()}
+	}
+
+	fault := &Fault{}
+	if version == SoapVersion11 {
+		fault.FaultCode = sf.Code
+		fault.FaultString = sf.Reason
+	} else {
+		code := sf.Code
+		switch code {
+		case "", "Server":
+			code = "Receiver"
+		case "Client":
+			code = "Sender"
+		}
+		fc := &FaultCode{Value: code}
+		if sf.Subcode != "" {
+			fc.Subcode = &FaultSubcode{Value: sf.Subcode}
+		}
+		fault.Code = fc
+		fault.Reason = &FaultReason{Text: FaultReasonText{Value: sf.Reason, Lang: "en"}}
+	}
+	if sf.Detail != nil {
+		if detailBytes, err := xml.Marshal(sf.Detail); err == nil {
+			if version == SoapVersion11 {
+				fault.Detail11 = &rawDetailElement{Inner: detailBytes}
+			} else {
+				fault.Detail12 = &rawDetailElement{Inner: detailBytes}
+			}
+		}
+	}
+
+	envelope := Envelope{Xmlns: namespaceSoap11, Body: Body{Fault: fault}}
+	contentType := SoapContentType11
+	if version == SoapVersion12 {
+		envelope.Xmlns = namespaceSoap12
+		contentType = SoapContentType12
+	}
+	xmlBytes, marshalErr := xml.MarshalIndent(envelope, "", "\t")
+	if marshalErr != nil {
+		http.Error(w, marshalErr.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.WriteHeader(http.StatusInternalServerError)
+	w.Write(xmlBytes)
+}
+
+func (h *Handler) writeResponse(w http.ResponseWriter, version string, response interface{}, cs *callState) {
+	envelope := Envelope{Xmlns: namespaceSoap11, Body: Body{Content: response}}
+	contentType := SoapContentType11
+	if version == SoapVersion12 {
+		envelope.Xmlns = namespaceSoap12
+		contentType = SoapContentType12
+	}
+	xmlBytes, err := xml.MarshalIndent(envelope, "", "\t")
+	if err != nil {
+		h.writeFault(w, version, err)
+		return
+	}
+
+	if len(cs.attachments) == 0 {
+		w.Header().Set("Content-Type", contentType)
+		w.Write(xmlBytes)
+		return
+	}
+
+	var buf bytes.Buffer
+	mw := multipart.NewWriter(&buf)
+
+	rootHeader := textproto.MIMEHeader{}
+	rootHeader.Set("Content-Type", fmt.Sprintf(`application/xop+xml; charset=UTF-8; type=%q`, contentType))
+	rootHeader.Set("Content-Transfer-Encoding", "8bit")
+	rootHeader.Set("Content-ID", "<root.message>")
+	if rp, err := mw.CreatePart(rootHeader); err == nil {
+		rp.Write(xmlBytes)
+	}
+
+	for _, a := range cs.attachments {
+		ph := textproto.MIMEHeader{}
+		ph.Set("Content-Type", a.contentType)
+		ph.Set("Content-Transfer-Encoding", "binary")
+		ph.Set("Content-ID", "<"+a.contentID+">")
+		if p, err := mw.CreatePart(ph); err == nil {
+			p.Write(a.data)
+		}
+	}
+	mw.Close()
+
+	w.Header().Set("Content-Type", fmt.Sprintf(`multipart/related; type="application/xop+xml"; boundary=%q; start="<root.message>"`, mw.Boundary()))
+	w.Write(buf.Bytes())
+}
+
+// attachment is a single MTOM/XOP binary part queued via AttachResponse.
+type attachment struct {
+	contentID   string
+	contentType string
+	data        []byte
+}
+
+// callState carries per-call state, such as queued attachments, through
+// the context.Context passed to a registered operation.
+type callState struct {
+	attachments []attachment
+}
+
+type callStateKeyType struct{}
+
+var callStateKey = callStateKeyType{}
+
+// AttachResponse queues a binary part to be sent alongside the SOAP
+// response as an MTOM/XOP attachment, identified by contentID. It must be
+// called with the context.Context passed into a registered operation's
+// handler function.
+func AttachResponse(ctx context.Context, contentID, contentType string, data []byte) {
+	if cs, ok := ctx.Value(callStateKey).(*callState); ok {
+		cs.attachments = append(cs.attachments, attachment{contentID: contentID, contentType: contentType, data: data})
+	}
+}
+
+// Server is a convenience wrapper pairing a Handler with an address to
+// listen on.
+type Server struct {
+	*Handler
+	Addr string
+}
+
+// NewServer constructs a Server listening on addr. Register operations via
+// RegisterOperation before calling ListenAndServe.
+func NewServer(addr string) *Server {
+	return &Server{Handler: NewHandler(), Addr: addr}
+}
+
+// ListenAndServe starts serving registered operations on s.Addr.
+func (s *Server) ListenAndServe() error {
+	return http.ListenAndServe(s.Addr, s)
+}
@@ -0,0 +1,137 @@
+package soap
+
+import (
+	"context"
+	"mime"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+type echoRequest struct {
+	XMLName struct{} `xml:"EchoRequest"`
+	Message string   `xml:"Message"`
+}
+
+type echoResponse struct {
+	XMLName struct{} `xml:"EchoResponse"`
+	Message string   `xml:"Message"`
+}
+
+func TestRegisterOperationPanicsOnBadSignature(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Fatal("expected RegisterOperation to panic on a bad signature")
+		}
+	}()
+	h := NewHandler()
+	h.RegisterOperation("Echo", func(req *echoRequest) (*echoResponse, error) { return nil, nil })
+}
+
+func TestHandlerServeHTTPDispatchesSoap11AndSoap12(t *testing.T) {
+	h := NewHandler()
+	h.RegisterOperation("Echo", func(ctx context.Context, req *echoRequest) (*echoResponse, error) {
+		return &echoResponse{Message: req.Message}, nil
+	})
+
+	cases := []struct {
+		name        string
+		contentType string
+		soapAction  string
+		body        string
+	}{
+		{
+			name:        "soap11",
+			contentType: SoapContentType11,
+			soapAction:  `"Echo"`,
+			body:        `<Envelope xmlns="http://schemas.xmlsoap.org/soap/envelope/"><Body><EchoRequest><Message>hi</Message></EchoRequest></Body></Envelope>`,
+		},
+		{
+			name:        "soap12",
+			contentType: `application/soap+xml; charset=utf-8; action="Echo"`,
+			soapAction:  "",
+			body:        `<Envelope xmlns="http://www.w3.org/2003/05/soap-envelope"><Body><EchoRequest><Message>hi</Message></EchoRequest></Body></Envelope>`,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			r := httptest.NewRequest("POST", "/", strings.NewReader(tc.body))
+			r.Header.Set("Content-Type", tc.contentType)
+			if tc.soapAction != "" {
+				r.Header.Set("SOAPAction", tc.soapAction)
+			}
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, r)
+
+			if !strings.Contains(w.Body.String(), "<Message>hi</Message>") {
+				t.Fatalf("unexpected response body: %s", w.Body.String())
+			}
+		})
+	}
+}
+
+func TestHandlerServeHTTPUnknownOperationFaults(t *testing.T) {
+	h := NewHandler()
+	body := `<Envelope xmlns="http://schemas.xmlsoap.org/soap/envelope/"><Body><EchoRequest/></Body></Envelope>`
+	r := httptest.NewRequest("POST", "/", strings.NewReader(body))
+	r.Header.Set("Content-Type", SoapContentType11)
+	r.Header.Set("SOAPAction", `"Nope"`)
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+
+	if !strings.Contains(w.Body.String(), "<faultcode>Client</faultcode>") {
+		t.Fatalf("expected a Client fault, got: %s", w.Body.String())
+	}
+	if strings.Contains(w.Body.String(), "<Node>") || strings.Contains(w.Body.String(), "<Role>") {
+		t.Fatalf("SOAP 1.1 fault should not carry SOAP 1.2 fields: %s", w.Body.String())
+	}
+}
+
+func TestHandlerWriteFaultOmitsOtherVersionFields(t *testing.T) {
+	h := NewHandler()
+	h.RegisterOperation("Echo", func(ctx context.Context, req *echoRequest) (*echoResponse, error) {
+		return nil, &ServiceFault{Code: "Sender", Reason: "bad input"}
+	})
+
+	body := `<Envelope xmlns="http://www.w3.org/2003/05/soap-envelope"><Body><EchoRequest/></Body></Envelope>`
+	r := httptest.NewRequest("POST", "/", strings.NewReader(body))
+	r.Header.Set("Content-Type", `application/soap+xml; charset=utf-8; action="Echo"`)
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+
+	for _, unwanted := range []string{"<faultcode>", "<faultstring>", "<faultactor>", "<Node>", "<Role>"} {
+		if strings.Contains(w.Body.String(), unwanted) {
+			t.Fatalf("SOAP 1.2 fault should not contain %s: %s", unwanted, w.Body.String())
+		}
+	}
+	if !strings.Contains(w.Body.String(), "<Value>Sender</Value>") {
+		t.Fatalf("expected SOAP 1.2 Code/Value, got: %s", w.Body.String())
+	}
+}
+
+func TestHandlerAttachResponseProducesMultipart(t *testing.T) {
+	h := NewHandler()
+	h.RegisterOperation("Echo", func(ctx context.Context, req *echoRequest) (*echoResponse, error) {
+		AttachResponse(ctx, "part1@soap", "application/octet-stream", []byte("binary-data"))
+		return &echoResponse{Message: req.Message}, nil
+	})
+
+	body := `<Envelope xmlns="http://schemas.xmlsoap.org/soap/envelope/"><Body><EchoRequest><Message>hi</Message></EchoRequest></Body></Envelope>`
+	r := httptest.NewRequest("POST", "/", strings.NewReader(body))
+	r.Header.Set("Content-Type", SoapContentType11)
+	r.Header.Set("SOAPAction", `"Echo"`)
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+
+	mediaType, _, err := mime.ParseMediaType(w.Header().Get("Content-Type"))
+	if err != nil {
+		t.Fatalf("ParseMediaType: %v", err)
+	}
+	if !strings.HasPrefix(mediaType, "multipart/") {
+		t.Fatalf("expected a multipart response, got Content-Type %q", w.Header().Get("Content-Type"))
+	}
+	if !strings.Contains(w.Body.String(), "binary-data") {
+		t.Fatalf("expected attachment data in body, got: %s", w.Body.String())
+	}
+}